@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2020-2021 Martynas Pumputis */
+/* Copyright (C) 2021 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/cilium/ebpf"
+)
+
+// cfg mirrors `struct cfg` in bpf/kprobe_pwru.c. It is written once at
+// startup into cfgMap's single entry, and read back by every BPF program to
+// decide whether to early-return on a given skb.
+type cfg struct {
+	Mark    uint32
+	Proto   uint8
+	SrcIP   [16]byte
+	DstIP   [16]byte
+	SrcPort uint16
+	DstPort uint16
+
+	NetNS    uint32
+	CgroupID uint64
+	PID      uint32
+}
+
+// ConfigBPFMap translates the parsed CLI flags into the cfg struct consumed
+// by the BPF programs, and writes it into the single-entry cfgMap.
+func ConfigBPFMap(flags *Flags, cfgMap *ebpf.Map) error {
+	var c cfg
+
+	c.Mark = uint32(*flags.FilterMark)
+
+	switch *flags.FilterProto {
+	case "tcp":
+		c.Proto = 6
+	case "udp":
+		c.Proto = 17
+	case "icmp":
+		c.Proto = 1
+	}
+
+	if ip := net.ParseIP(*flags.FilterSrcIP); ip != nil {
+		copy(c.SrcIP[:], ip.To16())
+	}
+	if ip := net.ParseIP(*flags.FilterDstIP); ip != nil {
+		copy(c.DstIP[:], ip.To16())
+	}
+
+	if *flags.FilterSrcPort != "" {
+		port, err := strconv.ParseUint(*flags.FilterSrcPort, 10, 16)
+		if err != nil {
+			return fmt.Errorf("parsing --filter-src-port: %w", err)
+		}
+		c.SrcPort = uint16(port)
+	}
+	if *flags.FilterDstPort != "" {
+		port, err := strconv.ParseUint(*flags.FilterDstPort, 10, 16)
+		if err != nil {
+			return fmt.Errorf("parsing --filter-dst-port: %w", err)
+		}
+		c.DstPort = uint16(port)
+	}
+
+	if *flags.FilterNetNS != "" {
+		netns, err := resolveNetNSInode(*flags.FilterNetNS)
+		if err != nil {
+			return fmt.Errorf("resolving --filter-netns: %w", err)
+		}
+		c.NetNS = netns
+	}
+
+	if *flags.FilterCgroupPath != "" {
+		id, err := resolveCgroupID(*flags.FilterCgroupPath)
+		if err != nil {
+			return fmt.Errorf("resolving --filter-cgroup-path: %w", err)
+		}
+		c.CgroupID = id
+	}
+
+	if *flags.FilterPID != 0 {
+		c.PID = uint32(*flags.FilterPID)
+	}
+
+	key := uint32(0)
+	if err := cfgMap.Update(&key, &c, ebpf.UpdateAny); err != nil {
+		return fmt.Errorf("failed to set pwru config: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2020-2021 Martynas Pumputis */
+/* Copyright (C) 2021 Authors of Cilium */
+
+package pwru
+
+// Event mirrors the `struct event` emitted by the BPF programs into the
+// perf event array. Field order and sizes must stay in sync with the C
+// definition in bpf/kprobe_pwru.c. Every probe backend (kprobe,
+// tracepoint, fentry, ...) is required to emit this exact same layout:
+// main's event loop decodes every backend's perf samples with a single
+// binary.Read into one Event rather than dispatching by probe type, so a
+// backend whose `struct event` drifts from this one would be silently
+// misparsed. main guards against that by checking each sample's size
+// against binary.Size(Event{}) before decoding it.
+type Event struct {
+	PID     uint32
+	Type    uint32
+	Addr    uint64
+	SAddr   [16]byte
+	DAddr   [16]byte
+	Tuple   Tuple
+	Meta    SkbMeta
+	CPU     uint32
+	Ts      uint64
+}
+
+// Tuple is the L3/L4 5-tuple decoded by the BPF program, valid only when
+// --output-tuple is set.
+type Tuple struct {
+	L4Proto uint8
+	SPort   uint16
+	DPort   uint16
+}
+
+// SkbMeta captures a handful of sk_buff fields useful for debugging,
+// populated only when --output-meta is set.
+type SkbMeta struct {
+	Mark uint32
+	Len  uint32
+}
@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2021 Authors of Cilium */
+
+package pwru
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// resolveCgroupID resolves path (a cgroup v2 directory) to the cgroup id
+// the kernel hands out for it, via name_to_handle_at(2). This is the same
+// id bpf_get_current_cgroup_id() returns in the BPF program, so the two
+// can be compared directly in cfg_map.
+func resolveCgroupID(path string) (uint64, error) {
+	handle, _, err := unix.NameToHandleAt(unix.AT_FDCWD, path, 0)
+	if err != nil {
+		return 0, fmt.Errorf("name_to_handle_at %s: %w", path, err)
+	}
+
+	b := handle.Bytes()
+	if len(b) < 8 {
+		return 0, fmt.Errorf("name_to_handle_at %s: unexpected handle length %d", path, len(b))
+	}
+
+	return binary.LittleEndian.Uint64(b[:8]), nil
+}
+
+// resolveNetNSInode resolves path (typically /proc/<pid>/ns/net) to the
+// inode number identifying that network namespace, matching
+// BPF_CORE_READ(skb, dev, nd_net.net, ns.inum) on the BPF side.
+func resolveNetNSInode(path string) (uint32, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		return 0, fmt.Errorf("stat %s: %w", path, err)
+	}
+	return uint32(stat.Ino), nil
+}
@@ -0,0 +1,34 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2020-2021 Martynas Pumputis */
+/* Copyright (C) 2021 Authors of Cilium */
+
+package pwru
+
+// Flags holds the parsed command-line flags shared by the BPF config and the
+// output formatter.
+type Flags struct {
+	FilterMark    *int
+	FilterProto   *string
+	FilterSrcIP   *string
+	FilterDstIP   *string
+	FilterSrcPort *string
+	FilterDstPort *string
+
+	OutputRelativeTS *bool
+	OutputMeta       *bool
+	OutputTuple      *bool
+	OutputSkb        *bool
+
+	ProbeBackend *string
+
+	Mode        *string
+	MetricsAddr *string
+
+	OutputFormat        *string
+	OutputFile          *string
+	OutputFileMaxSizeMB *int
+
+	FilterNetNS      *string
+	FilterCgroupPath *string
+	FilterPID        *int
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2020-2021 Martynas Pumputis */
+/* Copyright (C) 2021 Authors of Cilium */
+
+package pwru
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	availFilterFuncs = "/sys/kernel/debug/tracing/available_filter_functions"
+	kallsyms         = "/proc/kallsyms"
+)
+
+// GetFuncs returns the set of kernel functions that accept an skb (or an
+// equivalent tracepoint/fentry argument) as one of their first five
+// arguments, mapped to the 1-based position of that argument.
+//
+// The position is only meaningful to the kprobe backend, which dispatches to
+// one of five kprobe programs based on where the skb argument sits; other
+// backends ignore it.
+func GetFuncs() (map[string]int, error) {
+	f, err := os.Open(availFilterFuncs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", availFilterFuncs, err)
+	}
+	defer f.Close()
+
+	funcs := map[string]int{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.TrimSuffix(fields[0], ":")
+		if !skbAcceptingFuncs[name] {
+			continue
+		}
+		funcs[name] = skbArgPosition(name)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", availFilterFuncs, err)
+	}
+
+	return funcs, nil
+}
+
+// GetAddrs resolves the kernel addresses of funcs via /proc/kallsyms and
+// returns the reverse mapping used to turn addresses back into symbol names
+// at output time.
+func GetAddrs(funcs map[string]int) (map[uint64]string, error) {
+	f, err := os.Open(kallsyms)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", kallsyms, err)
+	}
+	defer f.Close()
+
+	addrs := map[uint64]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		name := fields[2]
+		if _, ok := funcs[name]; !ok {
+			continue
+		}
+		var addr uint64
+		if _, err := fmt.Sscanf(fields[0], "%x", &addr); err != nil {
+			continue
+		}
+		addrs[addr] = name
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", kallsyms, err)
+	}
+
+	return addrs, nil
+}
+
+// skbAcceptingFuncs is the curated list of kernel functions known to receive
+// an sk_buff among their arguments. It is intentionally small here; the real
+// list is generated from kernel headers.
+var skbAcceptingFuncs = map[string]bool{
+	"__netif_receive_skb_core": true,
+	"ip_rcv":                   true,
+	"ip_rcv_core":              true,
+	"tcp_v4_rcv":               true,
+	"udp_rcv":                  true,
+}
+
+func skbArgPosition(name string) int {
+	switch name {
+	case "__netif_receive_skb_core":
+		return 1
+	case "ip_rcv", "ip_rcv_core":
+		return 2
+	case "tcp_v4_rcv", "udp_rcv":
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2021 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/cilium/ebpf"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// latencyBuckets are the log2(ns) histogram bucket upper bounds shared with
+// the BPF side: bucket i covers (2^(i-1), 2^i] nanoseconds, so 32 buckets
+// span up to 2^31ns (~2.1s), which comfortably covers skb dwell times.
+const latencyBuckets = 32
+
+// edgeKey identifies a (prev probe, current probe) pair in the BPF latency
+// map, matching `struct edge_key` in bpf/kprobe_pwru.c.
+type edgeKey struct {
+	PrevAddr uint64
+	CurAddr  uint64
+}
+
+// LatencyCollector is a prometheus.Collector that reads the per-edge,
+// per-cpu log-scale histograms pwru's kprobe programs maintain in
+// --mode=latency, sums the per-cpu buckets, and exposes them as a
+// Prometheus histogram labelled by the resolved source/destination
+// function names.
+type LatencyCollector struct {
+	m         *ebpf.Map
+	addr2name map[uint64]string
+
+	desc *prometheus.Desc
+}
+
+// NewLatencyCollector creates a collector over m, the BPF_MAP_TYPE_PERCPU_HASH
+// of edgeKey to per-bucket counts populated by the latency-mode BPF
+// programs.
+func NewLatencyCollector(m *ebpf.Map, addr2name map[uint64]string) *LatencyCollector {
+	return &LatencyCollector{
+		m:         m,
+		addr2name: addr2name,
+		desc: prometheus.NewDesc(
+			"pwru_skb_latency_seconds",
+			"Time an skb spent between two consecutive pwru probe hits.",
+			[]string{"src_func", "dst_func"}, nil,
+		),
+	}
+}
+
+func (c *LatencyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *LatencyCollector) Collect(ch chan<- prometheus.Metric) {
+	var (
+		key     edgeKey
+		perCPU  [][latencyBuckets]uint64
+		entries = c.m.Iterate()
+	)
+
+	for entries.Next(&key, &perCPU) {
+		var total [latencyBuckets]uint64
+		for _, cpuBuckets := range perCPU {
+			for i, v := range cpuBuckets {
+				total[i] += v
+			}
+		}
+
+		buckets := map[float64]uint64{}
+		var count uint64
+		var sum float64
+		cumulative := uint64(0)
+		for i, v := range total {
+			cumulative += v
+			upperNs := float64(uint64(1) << uint(i))
+			buckets[upperNs/1e9] = cumulative
+			count += v
+			sum += float64(v) * upperNs / 1e9
+		}
+
+		ch <- prometheus.MustNewConstHistogram(c.desc, count, sum, buckets,
+			c.funcName(key.PrevAddr), c.funcName(key.CurAddr))
+	}
+}
+
+func (c *LatencyCollector) funcName(addr uint64) string {
+	if name, ok := c.addr2name[addr]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%x", addr)
+}
+
+// ServeMetrics registers collectors and blocks serving a Prometheus
+// /metrics endpoint on addr until the listener errors or is closed.
+func ServeMetrics(addr string, collectors ...*LatencyCollector) error {
+	reg := prometheus.NewRegistry()
+	for _, c := range collectors {
+		reg.MustRegister(c)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+
+	return http.ListenAndServe(addr, mux)
+}
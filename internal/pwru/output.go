@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2020-2021 Martynas Pumputis */
+/* Copyright (C) 2021 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/cilium/ebpf"
+)
+
+// Output is the text EventWriter: the original, human-formatted pwru
+// output.
+type Output struct {
+	flags     *Flags
+	addr2name map[uint64]string
+	out       io.Writer
+	lastTs    uint64
+}
+
+// NewOutput creates an Output that renders events according to flags,
+// resolving addresses via addr2name, and writes them to out.
+func NewOutput(flags *Flags, addr2name map[uint64]string, out io.Writer) *Output {
+	return &Output{
+		flags:     flags,
+		addr2name: addr2name,
+		out:       out,
+	}
+}
+
+// Header writes the column header line for the fixed leading columns that
+// every event line starts with (function address, CPU, function name). The
+// optional meta, tuple and timestamp fields that follow are not labelled.
+func (o *Output) Header() {
+	fmt.Fprintf(o.out, "%-18s %-6s %-30s\n", "ADDR", "CPU", "FUNC")
+}
+
+// WriteEvent renders a single decoded event. printSkbMap is the active
+// probe backend's skb-dump map, or nil if it doesn't support
+// --output-skb; each backend may keep its own map, so the caller picks
+// the right one per event rather than Output holding a single global map.
+func (o *Output) WriteEvent(e *Event, printSkbMap *ebpf.Map) error {
+	ts := e.Ts
+	if *o.flags.OutputRelativeTS {
+		if o.lastTs == 0 {
+			o.lastTs = ts
+		}
+		ts -= o.lastTs
+	}
+
+	name := o.addr2name[e.Addr]
+	if name == "" {
+		name = fmt.Sprintf("0x%x", e.Addr)
+	}
+
+	fmt.Fprintf(o.out, "%-18x %-6d %-30s", e.Addr, e.CPU, name)
+
+	if *o.flags.OutputMeta {
+		fmt.Fprintf(o.out, " mark=%#x len=%d", e.Meta.Mark, e.Meta.Len)
+	}
+
+	if *o.flags.OutputTuple {
+		fmt.Fprintf(o.out, " %s %s:%d->%s:%d",
+			protoName(e.Tuple.L4Proto),
+			net.IP(e.SAddr[:4]), e.Tuple.SPort,
+			net.IP(e.DAddr[:4]), e.Tuple.DPort)
+	}
+
+	fmt.Fprintf(o.out, " %s\n", time.Duration(ts))
+
+	if *o.flags.OutputSkb && printSkbMap != nil {
+		if data, err := lookupSkb(printSkbMap, e.Addr); err != nil {
+			fmt.Fprintf(o.out, "failed to look up skb dump: %s\n", err)
+		} else {
+			fmt.Fprintf(o.out, "%s\n", hexDump(data))
+		}
+	}
+
+	return nil
+}
+
+// Close is a no-op for Output; the underlying writer's lifetime is owned
+// by whoever constructed it.
+func (o *Output) Close() error { return nil }
+
+// lookupSkb fetches the raw skb bytes pwru stashed in printSkbMap for the
+// given event address.
+func lookupSkb(printSkbMap *ebpf.Map, key uint64) ([]byte, error) {
+	var data []byte
+	if err := printSkbMap.Lookup(&key, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func protoName(proto uint8) string {
+	switch proto {
+	case 6:
+		return "tcp"
+	case 17:
+		return "udp"
+	case 1:
+		return "icmp"
+	default:
+		return fmt.Sprintf("proto-%d", proto)
+	}
+}
+
+func hexDump(b []byte) string {
+	out := ""
+	for i, c := range b {
+		if i > 0 && i%16 == 0 {
+			out += "\n"
+		}
+		out += fmt.Sprintf("%02x ", c)
+	}
+	return out
+}
@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2020-2021 Martynas Pumputis */
+/* Copyright (C) 2021 Authors of Cilium */
+
+package pwru
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// ProbeConfig bundles everything a Probe needs to load and attach itself,
+// so that main doesn't need to know any backend-specific details.
+type ProbeConfig struct {
+	Flags     *Flags
+	Funcs     map[string]int
+	Addr2Name map[uint64]string
+}
+
+// Probe is implemented by each probe backend (kprobe, tracepoint, fentry,
+// ...). Backends register themselves into the package-level registry via
+// init(), mirroring how exporter plugins self-register in kubeskoop.
+type Probe interface {
+	// Name identifies the backend for --probe-backend and log output.
+	Name() string
+	// Load loads the backend's BPF objects for the given config.
+	Load(cfg ProbeConfig) error
+	// Attach attaches the loaded programs and returns the resulting
+	// links, which the caller is responsible for closing.
+	Attach(ctx context.Context) ([]link.Link, error)
+	// Events returns the perf event array the backend writes pwru.Event
+	// records into.
+	Events() *ebpf.Map
+	// PrintSkbMap returns the map holding raw skb dumps, or nil if the
+	// backend doesn't support --output-skb.
+	PrintSkbMap() *ebpf.Map
+	// Close releases the backend's loaded BPF objects.
+	Close() error
+}
+
+// LatencyProbe is implemented by backends that support --mode=latency,
+// aggregating per-edge dwell time into a BPF histogram map instead of
+// emitting a perf sample per skb.
+type LatencyProbe interface {
+	Probe
+	// LatencyMap returns the BPF_MAP_TYPE_PERCPU_HASH of edge to
+	// log-scale bucket counts populated while in latency mode.
+	LatencyMap() *ebpf.Map
+}
+
+// ProbeFactory constructs a fresh, unloaded Probe instance.
+type ProbeFactory func() Probe
+
+var registry = map[string]ProbeFactory{}
+
+// RegisterProbe adds a probe backend to the registry under name, so that it
+// becomes selectable via --probe-backend. Probe packages call this from
+// their init() function.
+func RegisterProbe(name string, factory ProbeFactory) {
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("pwru: probe backend %q registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// NewProbes instantiates one Probe per requested backend name.
+func NewProbes(names []string) ([]Probe, error) {
+	probes := make([]Probe, 0, len(names))
+	for _, name := range names {
+		factory, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown probe backend %q", name)
+		}
+		probes = append(probes, factory())
+	}
+	return probes, nil
+}
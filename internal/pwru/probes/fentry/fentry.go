@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2021 Authors of Cilium */
+
+// Package fentry implements a pwru probe backend using fentry programs
+// instead of kprobes. It requires a kernel with BTF and fentry support
+// (>=5.5) but avoids the per-call trampoline overhead of kprobes, at the
+// cost of needing a BTF-typed attach point per traced function.
+package fentry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+
+	"github.com/cilium/pwru/internal/pwru"
+)
+
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc clang FentryPWRU ./bpf/fentry_pwru.c -- -I../../../../bpf/headers
+
+func init() {
+	pwru.RegisterProbe("fentry", func() pwru.Probe { return &probe{} })
+}
+
+type probe struct {
+	cfg         pwru.ProbeConfig
+	prog        *ebpf.Program
+	events      *ebpf.Map
+	printSkbMap *ebpf.Map
+	close       func() error
+}
+
+func (p *probe) Name() string { return "fentry" }
+
+func (p *probe) Load(cfg pwru.ProbeConfig) error {
+	p.cfg = cfg
+
+	objs := FentryPWRUObjects{}
+	if err := LoadFentryPWRUObjects(&objs, nil); err != nil {
+		return err
+	}
+
+	p.prog = objs.FentrySkb
+	p.events = objs.Events
+	if *cfg.Flags.OutputSkb {
+		p.printSkbMap = objs.PrintSkbMap
+	}
+	p.close = objs.Close
+
+	return pwru.ConfigBPFMap(cfg.Flags, objs.CfgMap)
+}
+
+func (p *probe) Attach(ctx context.Context) ([]link.Link, error) {
+	var links []link.Link
+
+	for name := range p.cfg.Funcs {
+		select {
+		case <-ctx.Done():
+			return links, nil
+		default:
+		}
+
+		l, err := link.AttachTracing(link.TracingOptions{
+			Program:    p.prog,
+			AttachType: ebpf.AttachTraceFEntry,
+			AttachTo:   name,
+		})
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return links, fmt.Errorf("attaching fentry to %s: %w", name, err)
+			}
+			continue
+		}
+		links = append(links, l)
+	}
+
+	if len(links) == 0 {
+		return nil, fmt.Errorf("fentry: no function could be attached")
+	}
+
+	return links, nil
+}
+
+func (p *probe) Events() *ebpf.Map      { return p.events }
+func (p *probe) PrintSkbMap() *ebpf.Map { return p.printSkbMap }
+func (p *probe) Close() error           { return p.close() }
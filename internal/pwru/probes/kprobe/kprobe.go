@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2020-2021 Martynas Pumputis */
+/* Copyright (C) 2021 Authors of Cilium */
+
+// Package kprobe implements the original pwru probe backend: five kprobe
+// programs, one per position of the skb argument in the traced function's
+// signature.
+package kprobe
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+
+	"github.com/cilium/pwru/internal/pwru"
+)
+
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc clang KProbePWRU ./bpf/kprobe_pwru.c -- -DOUTPUT_SKB -I../../../../bpf/headers
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc clang KProbePWRUWithoutOutputSKB ./bpf/kprobe_pwru.c -- -I../../../../bpf/headers
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc clang KProbePWRULatency ./bpf/kprobe_pwru.c -- -DLATENCY_MODE -I../../../../bpf/headers
+
+func init() {
+	pwru.RegisterProbe("kprobe", func() pwru.Probe { return &probe{} })
+}
+
+type probe struct {
+	cfg pwru.ProbeConfig
+
+	kprobes                                 [5]*ebpf.Program
+	cfgMap, events, printSkbMap, latencyMap *ebpf.Map
+
+	close func() error
+}
+
+func (p *probe) Name() string { return "kprobe" }
+
+func (p *probe) Load(cfg pwru.ProbeConfig) error {
+	p.cfg = cfg
+
+	switch {
+	case *cfg.Flags.Mode == "latency":
+		objs := KProbePWRULatencyObjects{}
+		if err := LoadKProbePWRULatencyObjects(&objs, nil); err != nil {
+			return err
+		}
+		p.kprobes = [5]*ebpf.Program{objs.KprobeSkb1, objs.KprobeSkb2, objs.KprobeSkb3, objs.KprobeSkb4, objs.KprobeSkb5}
+		p.cfgMap, p.latencyMap = objs.CfgMap, objs.LatencyMap
+		p.close = objs.Close
+	case *cfg.Flags.OutputSkb:
+		objs := KProbePWRUObjects{}
+		if err := LoadKProbePWRUObjects(&objs, nil); err != nil {
+			return err
+		}
+		p.kprobes = [5]*ebpf.Program{objs.KprobeSkb1, objs.KprobeSkb2, objs.KprobeSkb3, objs.KprobeSkb4, objs.KprobeSkb5}
+		p.cfgMap, p.events, p.printSkbMap = objs.CfgMap, objs.Events, objs.PrintSkbMap
+		p.close = objs.Close
+	default:
+		objs := KProbePWRUWithoutOutputSKBObjects{}
+		if err := LoadKProbePWRUWithoutOutputSKBObjects(&objs, nil); err != nil {
+			return err
+		}
+		p.kprobes = [5]*ebpf.Program{objs.KprobeSkb1, objs.KprobeSkb2, objs.KprobeSkb3, objs.KprobeSkb4, objs.KprobeSkb5}
+		p.cfgMap, p.events, p.printSkbMap = objs.CfgMap, objs.Events, nil
+		p.close = objs.Close
+	}
+
+	return pwru.ConfigBPFMap(cfg.Flags, p.cfgMap)
+}
+
+func (p *probe) Attach(ctx context.Context) ([]link.Link, error) {
+	var links []link.Link
+
+	for name, pos := range p.cfg.Funcs {
+		if pos < 1 || pos > 5 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return links, nil
+		default:
+		}
+
+		kp, err := link.Kprobe(name, p.kprobes[pos-1])
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return links, err
+			}
+			continue
+		}
+		links = append(links, kp)
+	}
+
+	return links, nil
+}
+
+func (p *probe) Events() *ebpf.Map      { return p.events }
+func (p *probe) PrintSkbMap() *ebpf.Map { return p.printSkbMap }
+func (p *probe) LatencyMap() *ebpf.Map  { return p.latencyMap }
+func (p *probe) Close() error           { return p.close() }
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2021 Authors of Cilium */
+
+// Package tracepoint implements a pwru probe backend built on raw
+// tracepoints (skb:kfree_skb, net:net_dev_queue, net:netif_receive_skb)
+// rather than kprobes. It trades the broad function coverage of the kprobe
+// backend for the lower, more predictable overhead of a fixed set of
+// well-known trace points.
+package tracepoint
+
+import (
+	"context"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+
+	"github.com/cilium/pwru/internal/pwru"
+)
+
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc clang TracepointPWRU ./bpf/tracepoint_pwru.c -- -I../../../../bpf/headers
+
+var tracepoints = []struct {
+	group, name string
+}{
+	{"skb", "kfree_skb"},
+	{"net", "net_dev_queue"},
+	{"net", "netif_receive_skb"},
+}
+
+func init() {
+	pwru.RegisterProbe("tracepoint", func() pwru.Probe { return &probe{} })
+}
+
+type probe struct {
+	prog        *ebpf.Program
+	events      *ebpf.Map
+	printSkbMap *ebpf.Map
+	close       func() error
+}
+
+func (p *probe) Name() string { return "tracepoint" }
+
+func (p *probe) Load(cfg pwru.ProbeConfig) error {
+	objs := TracepointPWRUObjects{}
+	if err := LoadTracepointPWRUObjects(&objs, nil); err != nil {
+		return err
+	}
+
+	p.prog = objs.TraceSkb
+	p.events = objs.Events
+	if *cfg.Flags.OutputSkb {
+		p.printSkbMap = objs.PrintSkbMap
+	}
+	p.close = objs.Close
+
+	return pwru.ConfigBPFMap(cfg.Flags, objs.CfgMap)
+}
+
+func (p *probe) Attach(ctx context.Context) ([]link.Link, error) {
+	var links []link.Link
+
+	for _, tp := range tracepoints {
+		select {
+		case <-ctx.Done():
+			return links, nil
+		default:
+		}
+
+		l, err := link.AttachRawTracepoint(link.RawTracepointOptions{
+			Name:    tp.name,
+			Program: p.prog,
+		})
+		if err != nil {
+			return links, err
+		}
+		links = append(links, l)
+	}
+
+	return links, nil
+}
+
+func (p *probe) Events() *ebpf.Map      { return p.events }
+func (p *probe) PrintSkbMap() *ebpf.Map { return p.printSkbMap }
+func (p *probe) Close() error           { return p.close() }
@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2021 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"os"
+)
+
+// RotatingFile is an io.WriteCloser over path that rotates to path+".1"
+// (overwriting any previous one) before a write would take it past
+// maxBytes, so a long-running trace piped to --output-file doesn't grow
+// without bound.
+type RotatingFile struct {
+	path     string
+	maxBytes int64
+
+	f    *os.File
+	size int64
+}
+
+// NewRotatingFile opens path for appending, picking up its current size so
+// rotation still triggers at the right point across restarts.
+func NewRotatingFile(path string, maxBytes int64) (*RotatingFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("stat %s: %w", path, err)
+	}
+
+	return &RotatingFile{path: path, maxBytes: maxBytes, f: f, size: info.Size()}, nil
+}
+
+// Write implements io.Writer, rotating the file first if p would push it
+// past maxBytes.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	if r.maxBytes > 0 && r.size+int64(len(p)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return fmt.Errorf("closing %s: %w", r.path, err)
+	}
+
+	if err := os.Rename(r.path, r.path+".1"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("rotating %s: %w", r.path, err)
+	}
+
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("reopening %s: %w", r.path, err)
+	}
+
+	r.f = f
+	r.size = 0
+	return nil
+}
+
+// Close closes the underlying file.
+func (r *RotatingFile) Close() error {
+	return r.f.Close()
+}
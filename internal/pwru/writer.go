@@ -0,0 +1,39 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2021 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/cilium/ebpf"
+)
+
+// EventWriter renders decoded events to some sink. It is the extension
+// point for output formats: downstream forks can add e.g. a Kafka or gRPC
+// sink by implementing this interface instead of patching main.
+type EventWriter interface {
+	// Header writes any format-specific preamble; a no-op for
+	// line-oriented formats like json/ndjson.
+	Header()
+	// WriteEvent renders a single decoded event. printSkbMap is the
+	// active probe backend's skb-dump map, or nil if it doesn't
+	// support --output-skb.
+	WriteEvent(e *Event, printSkbMap *ebpf.Map) error
+	// Close flushes and releases any resources the writer owns.
+	Close() error
+}
+
+// NewEventWriter builds the EventWriter selected by flags.OutputFormat,
+// writing to out.
+func NewEventWriter(flags *Flags, addr2name map[uint64]string, out io.Writer) (EventWriter, error) {
+	switch *flags.OutputFormat {
+	case "", "text":
+		return NewOutput(flags, addr2name, out), nil
+	case "json", "ndjson":
+		return NewJSONWriter(flags, addr2name, out), nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", *flags.OutputFormat)
+	}
+}
@@ -8,47 +8,50 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
-	"errors"
 	"flag"
-	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
-	pb "github.com/cheggaaa/pb/v3"
-	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
 	"github.com/cilium/ebpf/perf"
 	"golang.org/x/sys/unix"
 
 	"github.com/cilium/pwru/internal/pwru"
-)
 
-//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc clang KProbePWRU ./bpf/kprobe_pwru.c -- -DOUTPUT_SKB -I./bpf/headers
-//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc clang KProbePWRUWithoutOutputSKB ./bpf/kprobe_pwru.c -- -I./bpf/headers
+	_ "github.com/cilium/pwru/internal/pwru/probes/fentry"
+	_ "github.com/cilium/pwru/internal/pwru/probes/kprobe"
+	_ "github.com/cilium/pwru/internal/pwru/probes/tracepoint"
+)
 
 type Foo interface {
 	Close() error
 }
 
 func main() {
-	var (
-		kprobe1, kprobe2, kprobe3, kprobe4, kprobe5 *ebpf.Program
-		cfgMap, events, printSkbMap                 *ebpf.Map
-	)
-
 	flags := pwru.Flags{
-		FilterMark:       flag.Int("filter-mark", 0, "filter skb mark"),
-		FilterProto:      flag.String("filter-proto", "", "filter L4 protocol (tcp, udp, icmp)"),
-		FilterSrcIP:      flag.String("filter-src-ip", "", "filter source IP addr"),
-		FilterDstIP:      flag.String("filter-dst-ip", "", "filter destination IP addr"),
-		FilterSrcPort:    flag.String("filter-src-port", "", "filter source port"),
-		FilterDstPort:    flag.String("filter-dst-port", "", "filter destination port"),
-		OutputRelativeTS: flag.Bool("output-relative-timestamp", false, "print relative timestamp per skb"),
-		OutputMeta:       flag.Bool("output-meta", false, "print skb metadata"),
-		OutputTuple:      flag.Bool("output-tuple", false, "print L4 tuple"),
-		OutputSkb:        flag.Bool("output-skb", false, "print skb"),
+		FilterMark:          flag.Int("filter-mark", 0, "filter skb mark"),
+		FilterProto:         flag.String("filter-proto", "", "filter L4 protocol (tcp, udp, icmp)"),
+		FilterSrcIP:         flag.String("filter-src-ip", "", "filter source IP addr"),
+		FilterDstIP:         flag.String("filter-dst-ip", "", "filter destination IP addr"),
+		FilterSrcPort:       flag.String("filter-src-port", "", "filter source port"),
+		FilterDstPort:       flag.String("filter-dst-port", "", "filter destination port"),
+		OutputRelativeTS:    flag.Bool("output-relative-timestamp", false, "print relative timestamp per skb"),
+		OutputMeta:          flag.Bool("output-meta", false, "print skb metadata"),
+		OutputTuple:         flag.Bool("output-tuple", false, "print L4 tuple"),
+		OutputSkb:           flag.Bool("output-skb", false, "print skb"),
+		ProbeBackend:        flag.String("probe-backend", "kprobe", "comma-separated list of probe backends to use (kprobe, tracepoint, fentry)"),
+		Mode:                flag.String("mode", "trace", "trace: print/emit each event; latency: aggregate per-edge latency histograms instead of emitting events"),
+		MetricsAddr:         flag.String("metrics-addr", ":9090", "address to serve Prometheus /metrics on in --mode=latency"),
+		OutputFormat:        flag.String("output-format", "text", "output format: text, json, ndjson"),
+		OutputFile:          flag.String("output-file", "", "in addition to stdout, tee events to this file, rotating it before it would exceed --output-file-max-size-mb"),
+		OutputFileMaxSizeMB: flag.Int("output-file-max-size-mb", 100, "rotate --output-file before it would exceed this size in MiB; 0 disables rotation"),
+		FilterNetNS:         flag.String("filter-netns", "", "filter skbs by network namespace, given as a path to a netns file, e.g. /proc/<pid>/ns/net"),
+		FilterCgroupPath:    flag.String("filter-cgroup-path", "", "filter skbs by cgroup v2 path"),
+		FilterPID:           flag.Int("filter-pid", 0, "filter skbs by the tracing task's pid"),
 	}
 	flag.Parse()
 
@@ -81,124 +84,166 @@ func main() {
 		log.Fatalf("Failed to get function addrs: %s", err)
 	}
 
-	if *flags.OutputSkb {
-		objs := KProbePWRUObjects{}
-		if err := LoadKProbePWRUObjects(&objs, nil); err != nil {
-			log.Fatalf("Loading objects: %v", err)
-		}
-		defer objs.Close()
-		kprobe1 = objs.KprobeSkb1
-		kprobe2 = objs.KprobeSkb2
-		kprobe3 = objs.KprobeSkb3
-		kprobe4 = objs.KprobeSkb4
-		kprobe5 = objs.KprobeSkb5
-		cfgMap = objs.CfgMap
-		events = objs.Events
-		printSkbMap = objs.PrintSkbMap
-	} else {
-		objs := KProbePWRUWithoutOutputSKBObjects{}
-		if err := LoadKProbePWRUWithoutOutputSKBObjects(&objs, nil); err != nil {
-			log.Fatalf("Loading objects: %v", err)
-		}
-		defer objs.Close()
-		kprobe1 = objs.KprobeSkb1
-		kprobe2 = objs.KprobeSkb2
-		kprobe3 = objs.KprobeSkb3
-		kprobe4 = objs.KprobeSkb4
-		kprobe5 = objs.KprobeSkb5
-		cfgMap = objs.CfgMap
-		events = objs.Events
+	backends := strings.Split(*flags.ProbeBackend, ",")
+	probes, err := pwru.NewProbes(backends)
+	if err != nil {
+		log.Fatalf("Failed to resolve probe backends: %s", err)
 	}
 
-	pwru.ConfigBPFMap(&flags, cfgMap)
-
-	log.Println("Attaching kprobes...")
-	ignored := 0
-	bar := pb.StartNew(len(funcs))
-	for name, pos := range funcs {
-		fn := kprobe1
-		switch pos {
-		case 1:
-			fn = kprobe1
-		case 2:
-			fn = kprobe2
-		case 3:
-			fn = kprobe3
-		case 4:
-			fn = kprobe4
-		case 5:
-			fn = kprobe5
-		default:
-			ignored += 1
-			continue
+	probeCfg := pwru.ProbeConfig{
+		Flags:     &flags,
+		Funcs:     funcs,
+		Addr2Name: addr2name,
+	}
+
+	var links []link.Link
+	defer func() {
+		for _, l := range links {
+			l.Close()
 		}
-		select {
-		case <-ctx.Done():
-			return
-		default:
+	}()
+
+	latencyMode := *flags.Mode == "latency"
+
+	type source struct {
+		probe  pwru.Probe
+		reader *perf.Reader
+	}
+	var sources []source
+	var latencyProbes []pwru.LatencyProbe
+
+	for _, p := range probes {
+		log.Printf("Loading %s probe...", p.Name())
+		if err := p.Load(probeCfg); err != nil {
+			log.Fatalf("Loading %s probe: %s", p.Name(), err)
 		}
+		defer p.Close()
 
-		kp, err := link.Kprobe(name, fn)
-		bar.Increment()
+		log.Printf("Attaching %s probe...", p.Name())
+		probeLinks, err := p.Attach(ctx)
 		if err != nil {
-			if !errors.Is(err, os.ErrNotExist) {
-				log.Fatalf("Opening kprobe %s: %s\n", name, err)
-			} else {
-				ignored += 1
+			log.Fatalf("Attaching %s probe: %s", p.Name(), err)
+		}
+		links = append(links, probeLinks...)
+		log.Printf("%s: attached %d probes", p.Name(), len(probeLinks))
+
+		if latencyMode {
+			lp, ok := p.(pwru.LatencyProbe)
+			if !ok {
+				log.Fatalf("%s probe does not support --mode=latency", p.Name())
 			}
-		} else {
-			defer kp.Close()
+			latencyProbes = append(latencyProbes, lp)
+			continue
+		}
+
+		rd, err := perf.NewReader(p.Events(), os.Getpagesize())
+		if err != nil {
+			log.Fatalf("Creating perf event reader for %s: %s", p.Name(), err)
 		}
+		defer rd.Close()
+
+		sources = append(sources, source{probe: p, reader: rd})
 	}
-	bar.Finish()
-	fmt.Printf("Attached (ignored %d)\n", ignored)
 
-	rd, err := perf.NewReader(events, os.Getpagesize())
-	if err != nil {
-		log.Fatalf("Creating perf event reader: %s", err)
+	if latencyMode {
+		collectors := make([]*pwru.LatencyCollector, 0, len(latencyProbes))
+		for _, lp := range latencyProbes {
+			collectors = append(collectors, pwru.NewLatencyCollector(lp.LatencyMap(), addr2name))
+		}
+
+		log.Printf("Serving latency histograms on %s/metrics", *flags.MetricsAddr)
+		go func() {
+			if err := pwru.ServeMetrics(*flags.MetricsAddr, collectors...); err != nil && ctx.Err() == nil {
+				log.Fatalf("Serving metrics: %s", err)
+			}
+		}()
+		<-ctx.Done()
+		return
 	}
-	defer rd.Close()
 
 	go func() {
 		<-ctx.Done()
 
-		if err := rd.Close(); err != nil {
-			log.Fatalf("Closing perf event reader: %s", err)
+		for _, s := range sources {
+			if err := s.reader.Close(); err != nil {
+				log.Printf("Closing perf event reader for %s: %s", s.probe.Name(), err)
+			}
 		}
 	}()
 
 	log.Println("Listening for events..")
 
-	output := pwru.NewOutput(&flags, printSkbMap, addr2name)
-	output.PrintHeader()
-
-	var event pwru.Event
-	for {
-		record, err := rd.Read()
-		if err != nil {
-			if perf.IsClosed(err) {
-				return
+	// A single unified channel fans in events from every backend's perf
+	// reader so the rest of main only has to drain one loop, regardless
+	// of how many probe backends are active.
+	type record struct {
+		probe pwru.Probe
+		raw   []byte
+		lost  uint64
+	}
+	records := make(chan record)
+	for _, s := range sources {
+		go func(s source) {
+			for {
+				rec, err := s.reader.Read()
+				if err != nil {
+					if perf.IsClosed(err) {
+						return
+					}
+					log.Printf("Reading from %s perf event reader: %s", s.probe.Name(), err)
+					continue
+				}
+				records <- record{probe: s.probe, raw: rec.RawSample, lost: rec.LostSamples}
 			}
-			log.Printf("Reading from perf event reader: %s", err)
-		}
-
-		if record.LostSamples != 0 {
-			log.Printf("Perf event ring buffer full, dropped %d samples", record.LostSamples)
-			continue
-		}
+		}(s)
+	}
 
-		if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
-			log.Printf("Parsing perf event: %s", err)
-			continue
+	out := io.Writer(os.Stdout)
+	if *flags.OutputFile != "" {
+		rf, err := pwru.NewRotatingFile(*flags.OutputFile, int64(*flags.OutputFileMaxSizeMB)*1024*1024)
+		if err != nil {
+			log.Fatalf("Opening --output-file %s: %s", *flags.OutputFile, err)
 		}
+		defer rf.Close()
+		out = io.MultiWriter(os.Stdout, rf)
+	}
 
-		output.Print(&event)
+	writer, err := pwru.NewEventWriter(&flags, addr2name, out)
+	if err != nil {
+		log.Fatalf("Creating event writer: %s", err)
+	}
+	defer writer.Close()
+	writer.Header()
 
+	// Every probe backend is required to emit the exact same struct event
+	// layout (see pwru.Event's doc comment) so that a single binary.Read
+	// here can decode samples from any of them; guard that assumption
+	// instead of silently misparsing a backend that drifts from it.
+	var event pwru.Event
+	eventSize := binary.Size(event)
+	for {
 		select {
 		case <-ctx.Done():
-			break
-		default:
-			continue
+			return
+		case rec := <-records:
+			if rec.lost != 0 {
+				log.Printf("Perf event ring buffer full, dropped %d samples", rec.lost)
+				continue
+			}
+
+			if len(rec.raw) != eventSize {
+				log.Printf("%s: perf sample is %d bytes, want %d (struct event layout mismatch?), dropping", rec.probe.Name(), len(rec.raw), eventSize)
+				continue
+			}
+
+			if err := binary.Read(bytes.NewBuffer(rec.raw), binary.LittleEndian, &event); err != nil {
+				log.Printf("Parsing perf event: %s", err)
+				continue
+			}
+
+			if err := writer.WriteEvent(&event, rec.probe.PrintSkbMap()); err != nil {
+				log.Printf("Writing event: %s", err)
+			}
 		}
 	}
 }